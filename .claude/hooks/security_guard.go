@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 type HookData struct {
@@ -19,68 +26,1102 @@ type HookData struct {
 }
 
 type HookResponse struct {
-	Continue       bool   `json:"continue"`
-	StopReason     string `json:"stopReason,omitempty"`
-	SuppressOutput bool   `json:"suppressOutput,omitempty"`
+	Continue       bool      `json:"continue"`
+	StopReason     string    `json:"stopReason,omitempty"`
+	SuppressOutput bool      `json:"suppressOutput,omitempty"`
+	Findings       []Finding `json:"findings,omitempty"`
+}
+
+// Finding es el resultado estructurado de evaluar una PolicyRule contra los
+// argumentos de una invocación de herramienta.
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Matched  string `json:"matched"`
+	Tool     string `json:"tool"`
+}
+
+// Severity determina qué hace el hook cuando una regla matchea: info y warn
+// dejan continuar la ejecución, block la detiene.
+type Severity string
+
+const (
+	SeverityInfo  Severity = "info"
+	SeverityWarn  Severity = "warn"
+	SeverityBlock Severity = "block"
+)
+
+// PolicyRule es una entrada del archivo YAML de políticas. El pattern se
+// compila una sola vez, al cargar las políticas.
+type PolicyRule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	Pattern     string
+	Tools       []string
+	compiled    *regexp.Regexp
+}
+
+// appliesToTool indica si la regla debe evaluarse para la herramienta dada.
+// Una lista de Tools vacía significa "aplica a todas".
+func (r *PolicyRule) appliesToTool(toolName string) bool {
+	if len(r.Tools) == 0 {
+		return true
+	}
+	for _, t := range r.Tools {
+		if t == toolName {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPolicyDir es la ubicación estándar de los archivos de políticas del
+// usuario.
+const defaultPolicyDir = "~/.claude/hooks/policies"
+
+var policiesGlob = []string{"*.yaml", "*.yml"}
+
+// defaultPolicies son las reglas embebidas que se usan cuando no hay ningún
+// archivo de políticas externo, para preservar el comportamiento histórico
+// del hook sin exigir configuración.
+func defaultPolicies() []*PolicyRule {
+	return []*PolicyRule{
+		{Name: "env-file", Description: "Archivos .env contienen secretos sensibles", Severity: SeverityBlock, Pattern: `\.env`},
+		{Name: "envrc-file", Description: "Archivos .envrc contienen configuración sensible", Severity: SeverityBlock, Pattern: `\.envrc`},
+		{Name: "echo-env-var", Description: "No se permite leer variables de entorno por seguridad", Severity: SeverityBlock, Pattern: `echo.*\$\w+`},
+		{Name: "printenv", Description: "No se permite listar variables de entorno", Severity: SeverityBlock, Pattern: `printenv`},
+		{Name: "cat-password", Description: "Posible intento de leer credenciales", Severity: SeverityBlock, Pattern: `cat.*password`},
+		{Name: "grep-secret", Description: "Posible búsqueda de secretos", Severity: SeverityBlock, Pattern: `grep.*secret`},
+		{Name: "config-read", Description: "Leyendo archivo de configuración. Verificar que no contiene secretos.", Severity: SeverityWarn, Pattern: `config`, Tools: []string{"Read"}},
+		{Name: "external-download", Description: "Descargando contenido externo. Verificar origen seguro.", Severity: SeverityWarn, Pattern: `curl|wget`, Tools: []string{"Bash"}},
+	}
+}
+
+// loadPolicies carga las reglas desde los archivos YAML en dir. Si dir no
+// existe o no contiene archivos de políticas, se usan las reglas por
+// defecto para no romper instalaciones sin configuración.
+func loadPolicies(dir string) ([]*PolicyRule, error) {
+	dir = expandHome(dir)
+
+	var files []string
+	for _, pattern := range policiesGlob {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("policy glob %s: %w", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+
+	var rules []*PolicyRule
+	if len(files) == 0 {
+		rules = defaultPolicies()
+	} else {
+		for _, f := range files {
+			parsed, err := parsePolicyFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("parsing policy file %s: %w", f, err)
+			}
+			rules = append(rules, parsed...)
+		}
+	}
+
+	for _, r := range rules {
+		compiled, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid pattern %q: %w", r.Name, r.Pattern, err)
+		}
+		r.compiled = compiled
+	}
+
+	return rules, nil
+}
+
+// parsePolicyFile lee un archivo YAML con la forma:
+//
+//	rules:
+//	  - name: env-file
+//	    description: ...
+//	    severity: block
+//	    pattern: '\.env'
+//	    tools: [Read, Bash]
+//
+// El parser cubre únicamente este subconjunto (una lista de mapas escalares
+// bajo la clave "rules"), que es suficiente para la configuración de
+// políticas y evita depender de un paquete YAML externo.
+func parsePolicyFile(path string) ([]*PolicyRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*PolicyRule
+	var current *PolicyRule
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		trimmed := strings.TrimSpace(scanner.Text())
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "rules:" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") {
+			if current != nil {
+				rules = append(rules, current)
+			}
+			current = &PolicyRule{}
+			trimmed = strings.TrimPrefix(trimmed, "- ")
+		}
+
+		if current == nil {
+			continue
+		}
+
+		key, value, ok := splitYAMLField(trimmed)
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "name":
+			current.Name = value
+		case "description":
+			current.Description = value
+		case "severity":
+			current.Severity = Severity(value)
+		case "pattern":
+			current.Pattern = value
+		case "tools":
+			current.Tools = parseYAMLInlineList(value)
+		}
+	}
+	if current != nil {
+		rules = append(rules, current)
+	}
+
+	return rules, scanner.Err()
+}
+
+func splitYAMLField(line string) (key, value string, ok bool) {
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(line[:idx])
+	value = strings.TrimSpace(line[idx+1:])
+	value = strings.Trim(value, `"'`)
+	return key, value, true
+}
+
+func parseYAMLInlineList(value string) []string {
+	value = strings.TrimPrefix(value, "[")
+	value = strings.TrimSuffix(value, "]")
+	if value == "" {
+		return nil
+	}
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		part = strings.Trim(part, `"'`)
+		if part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// entropyScanTools son las herramientas cuyos argumentos se tokenizan en
+// busca de secretos de alta entropía (API keys, JWTs) que no matchean
+// ninguna regex conocida.
+var entropyScanTools = map[string]bool{"Bash": true, "Write": true, "Edit": true}
+
+// minEntropyTokenLen es la longitud mínima de un token para considerarlo
+// candidato a secreto; tokens más cortos generan demasiados falsos positivos.
+const minEntropyTokenLen = 20
+
+// secretKeywords, si aparecen como palabra completa en el mismo argumento
+// que un token de alta entropía, escalan el finding de info a block. Se
+// comparan por palabra completa (ver wordRe) para no disparar con
+// substrings incidentales como "turkey" o "keyword".
+var secretKeywords = map[string]bool{"token": true, "secret": true, "key": true, "password": true}
+
+var (
+	hexTokenRe   = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	uuidRe       = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	tokenSplitRe = regexp.MustCompile(`[\s="':]+`)
+	wordRe       = regexp.MustCompile(`[A-Za-z0-9]+`)
+)
+
+// containsSecretKeyword parte arg en palabras alfanuméricas (así "API_KEY"
+// aporta la palabra "KEY", separada por el guion bajo) y busca una
+// coincidencia exacta, insensible a mayúsculas, con secretKeywords.
+func containsSecretKeyword(arg string) bool {
+	for _, word := range wordRe.FindAllString(arg, -1) {
+		if secretKeywords[strings.ToLower(word)] {
+			return true
+		}
+	}
+	return false
+}
+
+// shannonEntropy calcula H = -Σ p_i log2 p_i sobre la distribución de
+// caracteres de s.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int, len(s))
+	for _, r := range s {
+		counts[r]++
+	}
+	length := float64(len(s))
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// isAllowlistedToken excluye formatos conocidos y benignos de alta entropía:
+// SHAs de git (hex de 40) y UUIDs.
+func isAllowlistedToken(token string) bool {
+	if len(token) == 40 && hexTokenRe.MatchString(token) {
+		return true
+	}
+	if uuidRe.MatchString(token) {
+		return true
+	}
+	return false
+}
+
+// entropyThreshold devuelve el umbral de entropía aplicable según el
+// charset del token: los tokens hexadecimales necesitan un umbral más bajo
+// porque su alfabeto de 16 símbolos limita la entropía máxima por caracter.
+func entropyThreshold(token string) float64 {
+	if hexTokenRe.MatchString(token) {
+		return 3.0
+	}
+	return 4.5
+}
+
+// scanEntropy tokeniza argsStr y reporta un Finding por cada token de alta
+// entropía que no esté en el allowlist. La severidad se escala a block si
+// el token aparece junto a una palabra clave de secreto en el mismo
+// argumento.
+func scanEntropy(toolName string, rawArgs []string) []Finding {
+	if !entropyScanTools[toolName] {
+		return nil
+	}
+
+	var findings []Finding
+	for _, arg := range rawArgs {
+		hasKeyword := containsSecretKeyword(arg)
+
+		for _, token := range tokenSplitRe.Split(arg, -1) {
+			if len(token) < minEntropyTokenLen || isAllowlistedToken(token) {
+				continue
+			}
+			if shannonEntropy(token) <= entropyThreshold(token) {
+				continue
+			}
+
+			severity := SeverityInfo
+			if hasKeyword {
+				severity = SeverityBlock
+			}
+
+			prefix := token[:4]
+			findings = append(findings, Finding{
+				Rule:     "high-entropy-token",
+				Severity: string(severity),
+				Matched:  prefix + "***",
+				Tool:     toolName,
+			})
+		}
+	}
+	return findings
+}
+
+// defaultAuditLogPath es la ubicación por defecto del log de auditoría.
+// Puede sobreescribirse con la variable de entorno CLAUDE_HOOK_AUDIT_LOG.
+const defaultAuditLogPath = "~/.claude/hooks/audit.log"
+
+// auditLogMaxBytes es el tamaño a partir del cual se rota el log.
+const auditLogMaxBytes = 10 * 1024 * 1024
+
+// auditLogKeep es la cantidad de archivos rotados que se conservan, además
+// del log activo.
+const auditLogKeep = 5
+
+// AuditEntry es la línea JSON persistida por cada invocación del hook.
+type AuditEntry struct {
+	Timestamp string `json:"timestamp"`
+	Tool      string `json:"tool"`
+	ArgsHash  string `json:"argsHash"`
+	Decision  string `json:"decision"`
+	Rule      string `json:"rule,omitempty"`
+	Severity  string `json:"severity,omitempty"`
+	PID       int    `json:"pid"`
+	Cwd       string `json:"cwd"`
+}
+
+// auditLogPath resuelve la ruta configurada del log de auditoría.
+func auditLogPath() string {
+	if p := os.Getenv("CLAUDE_HOOK_AUDIT_LOG"); p != "" {
+		return expandHome(p)
+	}
+	return expandHome(defaultAuditLogPath)
+}
+
+// rotateAuditLogIfNeeded rota path a path.1, desplazando path.N a path.N+1
+// hasta auditLogKeep, cuando el archivo supera auditLogMaxBytes.
+func rotateAuditLogIfNeeded(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() < auditLogMaxBytes {
+		return nil
+	}
+
+	oldest := fmt.Sprintf("%s.%d", path, auditLogKeep)
+	if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := auditLogKeep - 1; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d", path, i)
+		dst := fmt.Sprintf("%s.%d", path, i+1)
+		if err := os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// appendAuditLog agrega entry como una línea JSON a la ruta configurada,
+// rotando el archivo si hace falta.
+func appendAuditLog(entry AuditEntry) error {
+	path := auditLogPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := rotateAuditLogIfNeeded(path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// hashArgs calcula el hash sha256 de los argumentos completos, para poder
+// correlacionar invocaciones en el log sin persistir el contenido crudo.
+func hashArgs(argsStr string) string {
+	sum := sha256.Sum256([]byte(argsStr))
+	return hex.EncodeToString(sum[:])
+}
+
+// runReport implementa el subcomando "-report": lee el log de auditoría y
+// imprime estadísticas agregadas (reglas más bloqueadas, bloqueos por
+// herramienta, conteos por día).
+func runReport() error {
+	path := auditLogPath()
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	blocksByRule := map[string]int{}
+	blocksByTool := map[string]int{}
+	countsByDay := map[string]int{}
+	total := 0
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		total++
+		day := entry.Timestamp
+		if len(day) >= 10 {
+			day = day[:10]
+		}
+		countsByDay[day]++
+		if entry.Decision == "block" {
+			blocksByTool[entry.Tool]++
+			if entry.Rule != "" {
+				blocksByRule[entry.Rule]++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Total de invocaciones: %d\n\n", total)
+
+	fmt.Println("Bloqueos por regla:")
+	for _, k := range sortedKeysByCountDesc(blocksByRule) {
+		fmt.Printf("  %-30s %d\n", k, blocksByRule[k])
+	}
+
+	fmt.Println("\nBloqueos por herramienta:")
+	for _, k := range sortedKeysByCountDesc(blocksByTool) {
+		fmt.Printf("  %-30s %d\n", k, blocksByTool[k])
+	}
+
+	fmt.Println("\nInvocaciones por día:")
+	days := make([]string, 0, len(countsByDay))
+	for d := range countsByDay {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+	for _, d := range days {
+		fmt.Printf("  %-12s %d\n", d, countsByDay[d])
+	}
+
+	return nil
+}
+
+func sortedKeysByCountDesc(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// tokenizeShell es un lexer al estilo shlex: separa cmd en tokens por
+// espacios, respetando comillas simples y dobles y el escape con `\` fuera
+// de comillas. A diferencia de un simple strings.Fields, "c\"\"at" se
+// reconstruye como el token "cat", y `cat "my file.txt"` produce un único
+// token para el nombre de archivo.
+func tokenizeShell(cmd string) []string {
+	var tokens []string
+	var current strings.Builder
+	hasToken := false
+
+	var quote rune
+	escaped := false
+
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			hasToken = true
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			hasToken = true
+		case r == '\'' || r == '"':
+			quote = r
+			hasToken = true
+		case r == ' ' || r == '\t':
+			if hasToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				hasToken = false
+			}
+		default:
+			current.WriteRune(r)
+			hasToken = true
+		}
+	}
+	if hasToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// splitPipeline divide cmd en las etapas de un pipeline, separando por `|`
+// fuera de comillas.
+func splitPipeline(cmd string) []string {
+	var stages []string
+	var current strings.Builder
+	var quote rune
+
+	for _, r := range cmd {
+		switch {
+		case quote != 0:
+			current.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			current.WriteRune(r)
+		case r == '|':
+			stages = append(stages, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	stages = append(stages, current.String())
+	return stages
+}
+
+// fileReadCommands son los comandos que leen el contenido de un archivo
+// pasado como argumento.
+var fileReadCommands = map[string]bool{"cat": true, "less": true, "head": true, "tail": true}
+
+// shellInterpreters son los comandos que interpretan su stdin como un
+// script de shell.
+var shellInterpreters = map[string]bool{"sh": true, "bash": true, "zsh": true}
+
+var exportSubstitutionRe = regexp.MustCompile(`\bexport\s+\w+=\$\(`)
+
+// isSensitiveFilePath decide si path apunta a un archivo que un comando de
+// lectura (cat/less/head/tail) no debería exponer: archivos .env* o
+// cualquier cosa bajo ~/.ssh/.
+func isSensitiveFilePath(path string) bool {
+	if strings.Contains(path, ".env") {
+		return true
+	}
+	expanded := expandHome(path)
+	sshDir := expandHome("~/.ssh/")
+	return strings.Contains(expanded, sshDir) || strings.HasPrefix(expanded, strings.TrimSuffix(sshDir, "/"))
+}
+
+// isDecodePipelineStage reconoce etapas que decodifican base64/hex, una
+// técnica habitual para ofuscar secretos en un pipeline.
+func isDecodePipelineStage(tokens []string) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	switch tokens[0] {
+	case "base64":
+		for _, t := range tokens[1:] {
+			if t == "-d" || t == "--decode" || t == "-D" {
+				return true
+			}
+		}
+	case "xxd":
+		for _, t := range tokens[1:] {
+			if t == "-r" {
+				return true
+			}
+		}
+	case "openssl":
+		hasEnc, hasDecode := false, false
+		for _, t := range tokens[1:] {
+			if t == "enc" {
+				hasEnc = true
+			}
+			if t == "-d" || t == "-decrypt" {
+				hasDecode = true
+			}
+		}
+		return hasEnc && hasDecode
+	}
+	return false
+}
+
+// analyzeBashCommand aplica reglas conscientes de la sintaxis de shell
+// sobre un comando Bash, en lugar de buscar substrings sobre el texto
+// crudo: lectura de archivos sensibles, pipelines curl|sh y pipelines de
+// decodificación o de fuga de variables de entorno.
+func analyzeBashCommand(cmd string) []Finding {
+	var findings []Finding
+	stages := splitPipeline(cmd)
+
+	type parsedStage struct {
+		tokens []string
+		base   string
+	}
+	parsed := make([]parsedStage, 0, len(stages))
+	for _, stage := range stages {
+		tokens := tokenizeShell(stage)
+		base := ""
+		if len(tokens) > 0 {
+			base = filepath.Base(tokens[0])
+		}
+		parsed = append(parsed, parsedStage{tokens: tokens, base: base})
+	}
+
+	for _, stage := range parsed {
+		if !fileReadCommands[stage.base] {
+			continue
+		}
+		for _, arg := range stage.tokens[1:] {
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			if isSensitiveFilePath(arg) {
+				findings = append(findings, Finding{
+					Rule:     "sensitive-file-read",
+					Severity: string(SeverityBlock),
+					Matched:  stage.base + " " + arg,
+					Tool:     "Bash",
+				})
+			}
+		}
+	}
+
+	sawCurlOrWget := false
+	for _, stage := range parsed {
+		if stage.base == "curl" || stage.base == "wget" {
+			sawCurlOrWget = true
+			continue
+		}
+		if sawCurlOrWget && shellInterpreters[stage.base] {
+			findings = append(findings, Finding{
+				Rule:     "curl-pipe-shell",
+				Severity: string(SeverityBlock),
+				Matched:  cmd,
+				Tool:     "Bash",
+			})
+			break
+		}
+	}
+
+	if exportSubstitutionRe.MatchString(cmd) {
+		findings = append(findings, Finding{
+			Rule:     "export-command-substitution",
+			Severity: string(SeverityInfo),
+			Matched:  exportSubstitutionRe.FindString(cmd),
+			Tool:     "Bash",
+		})
+	}
+
+	for _, stage := range parsed {
+		if isDecodePipelineStage(stage.tokens) {
+			findings = append(findings, Finding{
+				Rule:     "decode-pipeline",
+				Severity: string(SeverityInfo),
+				Matched:  strings.Join(stage.tokens, " "),
+				Tool:     "Bash",
+			})
+		}
+	}
+
+	return findings
+}
+
+// pathAwareTools son las herramientas cuyos argumentos se interpretan como
+// rutas de archivo a resolver y validar contra la PathPolicy.
+var pathAwareTools = map[string]bool{"Read": true, "Write": true, "Edit": true, "Bash": true}
+
+// defaultPathPolicyFile es la ubicación del archivo de políticas de rutas.
+const defaultPathPolicyFile = "~/.claude/hooks/policies/paths.yaml"
+
+// PathPolicy define qué rutas están explícitamente permitidas o denegadas.
+// allow_paths solo tiene efecto dentro del workspace actual; deny_paths
+// siempre gana sobre allow_paths.
+type PathPolicy struct {
+	DenyPaths  []string
+	AllowPaths []string
+}
+
+// defaultDenyPaths son globs inspirados en las exclusiones habituales de
+// escáneres de secretos: directorios de estado de docker/containerd,
+// pseudo-filesystems, credenciales de nube y claves privadas.
+func defaultDenyPaths() []string {
+	return []string{
+		"**/.ssh/**",
+		"**/.aws/credentials",
+		"**/.aws/config",
+		"/etc/shadow",
+		"**/.git/config",
+		"**/*.pem",
+		"**/*.key",
+		"**/kubeconfig",
+		"**/.kube/config",
+		"/var/lib/docker/**",
+		"/var/lib/containerd/**",
+		"/proc/**",
+		"/sys/**",
+	}
+}
+
+// loadPathPolicy lee path (un YAML con claves deny_paths/allow_paths, cada
+// una una lista de globs) y la combina con los defaults. Si el archivo no
+// existe, se usan únicamente los defaults.
+func loadPathPolicy(path string) (*PathPolicy, error) {
+	path = expandHome(path)
+
+	policy := &PathPolicy{DenyPaths: defaultDenyPaths()}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return policy, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		trimmed := strings.TrimSpace(scanner.Text())
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		switch trimmed {
+		case "deny_paths:":
+			section = "deny"
+			continue
+		case "allow_paths:":
+			section = "allow"
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		item := strings.Trim(strings.TrimPrefix(trimmed, "- "), `"'`)
+		switch section {
+		case "deny":
+			policy.DenyPaths = append(policy.DenyPaths, item)
+		case "allow":
+			policy.AllowPaths = append(policy.AllowPaths, item)
+		}
+	}
+
+	return policy, scanner.Err()
+}
+
+// globToRegex traduce un glob estilo doublestar (soporta `**`, `*`, `?`) a
+// una regexp ancorada, para poder matchear rutas de la forma `**/.ssh/**`.
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '.', '+', '(', ')', '|', '^', '$', '[', ']', '{', '}', '\\':
+			sb.WriteString("\\")
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func matchesAnyGlob(path string, globs []string) bool {
+	for _, g := range globs {
+		re, err := regexp.Compile(globToRegex(g))
+		if err != nil {
+			continue
+		}
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithinRoot indica si path es igual a root o un descendiente de root,
+// respetando el separador de ruta como límite (a diferencia de
+// strings.HasPrefix, "/home/user/app2" no cuenta como descendiente de
+// "/home/user/app").
+func isWithinRoot(path, root string) bool {
+	root = filepath.Clean(root)
+	path = filepath.Clean(path)
+	return path == root || strings.HasPrefix(path, root+string(os.PathSeparator))
+}
+
+// resolvePathArg resuelve raw a una ruta absoluta relativa a cwd,
+// expandiendo `~` y siguiendo symlinks. Devuelve también si se detectó un
+// symlink que escapa de workspaceRoot.
+func resolvePathArg(raw, cwd, workspaceRoot string) (resolved string, symlinkEscape bool) {
+	expanded := expandHome(raw)
+	abs := expanded
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(cwd, abs)
+	}
+	abs = filepath.Clean(abs)
+
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs, false
+	}
+
+	if isWithinRoot(abs, workspaceRoot) && !isWithinRoot(real, workspaceRoot) {
+		return real, true
+	}
+	return real, false
+}
+
+// looksLikePath es un filtro barato para no tratar como ruta cualquier
+// string de texto libre: exige que empiece como una ruta real (absoluta,
+// con `~`, o explícitamente relativa con `./`/`../`). Esto es lo que evita
+// que contenido de texto como un `content` de Write o un `old_string` de
+// Edit, que puede simplemente mencionar una ruta sensible en prosa, se
+// interprete como la ruta en sí.
+func looksLikePath(s string) bool {
+	return strings.HasPrefix(s, "/") || strings.HasPrefix(s, "~") || strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../")
+}
+
+// checkPathPolicy valida los argumentos que parecen rutas contra la
+// PathPolicy: deny_paths bloquea siempre, allow_paths permite explícitamente
+// dentro del workspace, y un symlink que escapa del workspace se bloquea
+// aunque no matchee ningún glob. Para Bash se tokeniza el comando y solo se
+// consideran los tokens que looksLikePath acepta; para el resto de
+// herramientas, pathArgs debería ya traer solo el argumento `file_path`
+// (ver main), pero igualmente se filtra con looksLikePath para no resolver
+// argumentos de texto libre como si fueran rutas.
+func checkPathPolicy(toolName string, pathArgs []string, policy *PathPolicy, cwd string) []Finding {
+	if !pathAwareTools[toolName] {
+		return nil
+	}
+
+	var findings []Finding
+	for _, arg := range pathArgs {
+		var candidates []string
+		if toolName == "Bash" {
+			for _, tok := range tokenizeShell(arg) {
+				if looksLikePath(tok) {
+					candidates = append(candidates, tok)
+				}
+			}
+		} else if looksLikePath(arg) {
+			candidates = []string{arg}
+		}
+
+		for _, raw := range candidates {
+			resolved, symlinkEscape := resolvePathArg(raw, cwd, cwd)
+
+			if symlinkEscape {
+				findings = append(findings, Finding{
+					Rule:     "symlink-escape",
+					Severity: string(SeverityBlock),
+					Matched:  raw,
+					Tool:     toolName,
+				})
+				continue
+			}
+
+			if matchesAnyGlob(resolved, policy.DenyPaths) {
+				if isWithinRoot(resolved, cwd) && matchesAnyGlob(resolved, policy.AllowPaths) {
+					continue
+				}
+				findings = append(findings, Finding{
+					Rule:     "denied-path",
+					Severity: string(SeverityBlock),
+					Matched:  resolved,
+					Tool:     toolName,
+				})
+			}
+		}
+	}
+	return findings
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "-report" {
+		if err := runReport(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating report: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var data HookData
 	if err := json.NewDecoder(os.Stdin).Decode(&data); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing JSON: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Verificar herramienta y argumentos
 	toolName := data.Tool.Name
 
-	// Patrones de seguridad
-	dangerousPatterns := []struct {
-		pattern string
-		message string
-	}{
-		{`\.env`, "🚫 ACCESO DENEGADO: Archivos .env contienen secretos sensibles"},
-		{`\.envrc`, "🚫 ACCESO DENEGADO: Archivos .envrc contienen configuración sensible"},
-		{`echo.*\$\w+`, "🚫 ACCESO DENEGADO: No se permite leer variables de entorno por seguridad"},
-		{`printenv`, "🚫 ACCESO DENEGADO: No se permite listar variables de entorno"},
-		{`cat.*password`, "🚫 ACCESO DENEGADO: Posible intento de leer credenciales"},
-		{`grep.*secret`, "🚫 ACCESO DENEGADO: Posible búsqueda de secretos"},
+	policies, err := loadPolicies(defaultPolicyDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading policies: %v\n", err)
+		os.Exit(1)
 	}
 
 	// Convertir argumentos a string para análisis
 	argsStr := ""
+	var rawArgs []string
+	var bashCommand string
+	var filePath string
 	for _, arg := range data.Tool.Args {
 		if str, ok := arg.Value.(string); ok {
 			argsStr += str + " "
+			rawArgs = append(rawArgs, str)
+			if arg.Name == "command" {
+				bashCommand = str
+			}
+			if arg.Name == "file_path" {
+				filePath = str
+			}
 		}
 	}
 
-	// Verificar patrones peligrosos
-	for _, dp := range dangerousPatterns {
-		matched, _ := regexp.MatchString(dp.pattern, argsStr)
-		if matched {
-			response := HookResponse{
-				Continue:       false,
-				StopReason:     dp.message,
-				SuppressOutput: false,
+	var findings []Finding
+	blocked := false
+	var stopReason string
+	var blockingFinding Finding
+
+	for _, rule := range policies {
+		if !rule.appliesToTool(toolName) || rule.compiled == nil {
+			continue
+		}
+		match := rule.compiled.FindString(argsStr)
+		if match == "" {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Rule:     rule.Name,
+			Severity: string(rule.Severity),
+			Matched:  match,
+			Tool:     toolName,
+		})
+
+		switch rule.Severity {
+		case SeverityBlock:
+			if !blocked {
+				blocked = true
+				stopReason = "🚫 ACCESO DENEGADO: " + rule.Description
+				blockingFinding = findings[len(findings)-1]
 			}
-			json.NewEncoder(os.Stdout).Encode(response)
-			return
+		case SeverityWarn:
+			fmt.Fprintf(os.Stderr, "⚠️ AVISO [%s]: %s\n", rule.Name, rule.Description)
+		case SeverityInfo:
+			fmt.Fprintf(os.Stderr, "ℹ️ INFO [%s]: %s\n", rule.Name, rule.Description)
 		}
 	}
 
-	// Análisis contextual inteligente
-	if toolName == "Read" && strings.Contains(argsStr, "config") {
-		fmt.Fprintf(os.Stderr, "⚠️ AVISO: Leyendo archivo de configuración. Verificar que no contiene secretos.\n")
+	for _, f := range scanEntropy(toolName, rawArgs) {
+		findings = append(findings, f)
+		switch Severity(f.Severity) {
+		case SeverityBlock:
+			if !blocked {
+				blocked = true
+				stopReason = fmt.Sprintf("🚫 ACCESO DENEGADO: Token de alta entropía (%s) junto a una palabra clave de secreto", f.Matched)
+				blockingFinding = findings[len(findings)-1]
+			}
+		case SeverityInfo:
+			fmt.Fprintf(os.Stderr, "ℹ️ INFO [%s]: posible secreto de alta entropía en %s (%s)\n", f.Rule, f.Tool, f.Matched)
+		}
 	}
 
-	if toolName == "Bash" && (strings.Contains(argsStr, "curl") || strings.Contains(argsStr, "wget")) {
-		fmt.Fprintf(os.Stderr, "⚠️ AVISO: Descargando contenido externo. Verificar origen seguro.\n")
+	if toolName == "Bash" && bashCommand != "" {
+		for _, f := range analyzeBashCommand(bashCommand) {
+			findings = append(findings, f)
+			switch Severity(f.Severity) {
+			case SeverityBlock:
+				if !blocked {
+					blocked = true
+					stopReason = fmt.Sprintf("🚫 ACCESO DENEGADO: %s (%s)", f.Rule, f.Matched)
+					blockingFinding = findings[len(findings)-1]
+				}
+			case SeverityInfo:
+				fmt.Fprintf(os.Stderr, "ℹ️ INFO [%s]: %s\n", f.Rule, f.Matched)
+			}
+		}
+	}
+
+	if cwd, err := os.Getwd(); err == nil {
+		pathPolicy, err := loadPathPolicy(defaultPathPolicyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading path policy: %v\n", err)
+		} else {
+			var pathArgs []string
+			switch {
+			case toolName == "Bash" && bashCommand != "":
+				pathArgs = []string{bashCommand}
+			case toolName != "Bash" && filePath != "":
+				pathArgs = []string{filePath}
+			}
+			for _, f := range checkPathPolicy(toolName, pathArgs, pathPolicy, cwd) {
+				findings = append(findings, f)
+				if !blocked {
+					blocked = true
+					stopReason = fmt.Sprintf("🚫 ACCESO DENEGADO: %s (%s)", f.Rule, f.Matched)
+					blockingFinding = findings[len(findings)-1]
+				}
+			}
+		}
 	}
 
-	// Permitir ejecución
 	response := HookResponse{
-		Continue: true,
+		Continue: !blocked,
+		Findings: findings,
 	}
+	if blocked {
+		response.StopReason = stopReason
+	}
+
+	decision := "continue"
+	entry := AuditEntry{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Tool:      toolName,
+		ArgsHash:  hashArgs(argsStr),
+		PID:       os.Getpid(),
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		entry.Cwd = cwd
+	}
+	if blocked {
+		decision = "block"
+	}
+	entry.Decision = decision
+	switch {
+	case blocked:
+		entry.Rule = blockingFinding.Rule
+		entry.Severity = blockingFinding.Severity
+	case len(findings) > 0:
+		entry.Rule = findings[0].Rule
+		entry.Severity = findings[0].Severity
+	}
+	if err := appendAuditLog(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing audit log: %v\n", err)
+	}
+
 	json.NewEncoder(os.Stdout).Encode(response)
 }